@@ -0,0 +1,37 @@
+// Copyright (c) 2017, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client wraps the OCI Go SDK clients the provisioner talks to.
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/core"
+)
+
+// ProvisionerClient is the OCI-facing client the provisioner plugins use to
+// create/delete/update volumes and backups in a single compartment.
+type ProvisionerClient interface {
+	// BlockStorage returns the client used for all block volume and volume
+	// backup operations.
+	BlockStorage() core.BlockstorageClient
+	// CompartmentOCID is the compartment new volumes are created in.
+	CompartmentOCID() string
+	// Context is the base context OCI API calls are made with.
+	Context() context.Context
+	// Timeout bounds a single OCI API call.
+	Timeout() time.Duration
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"github.com/oracle/oci-go-sdk/common"
+	"github.com/oracle/oci-go-sdk/core"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// ProvisionerSecretNameParam and ProvisionerSecretNamespaceParam are
+	// StorageClass parameters that, when both set, name a Secret holding
+	// OCI credentials to provision/delete this volume with instead of the
+	// ambient ProvisionerClient credentials. This lets a single
+	// provisioner deployment create volumes across tenancies/compartments
+	// it isn't itself configured for. Both support ${pvc.name} and
+	// ${pvc.namespace} templating.
+	ProvisionerSecretNameParam      = "provisioner-secret-name"
+	ProvisionerSecretNamespaceParam = "provisioner-secret-namespace"
+
+	// ProvisionerSecretNameAnnotation and ProvisionerSecretNamespaceAnnotation
+	// carry the (still-templated) provisioner-secret-name/namespace
+	// StorageClass parameters onto the PV that was provisioned with them, so
+	// that Delete - which only ever sees the PV, not the original
+	// VolumeOptions - can re-resolve the same secret via the PV's ClaimRef.
+	ProvisionerSecretNameAnnotation      = "oraclecloud.com/provisioner-secret-name"
+	ProvisionerSecretNamespaceAnnotation = "oraclecloud.com/provisioner-secret-namespace"
+
+	secretKeyUser        = "user"
+	secretKeyTenancy     = "tenancy"
+	secretKeyFingerprint = "fingerprint"
+	secretKeyRegion      = "region"
+	secretKeyPrivateKey  = "key"
+	secretKeyPassphrase  = "passphrase"
+)
+
+// getProvisionSecretReference resolves the provisioner-secret-name/
+// provisioner-secret-namespace StorageClass parameters for a Provision
+// call, expanding ${pvc.name} and ${pvc.namespace} template references.
+// It returns ok == false when the StorageClass does not reference a
+// per-call secret, in which case callers should fall back to the ambient
+// ProvisionerClient.
+func getProvisionSecretReference(options controller.VolumeOptions) (namespace, name string, ok bool) {
+	nameTemplate, hasName := options.Parameters[ProvisionerSecretNameParam]
+	namespaceTemplate, hasNamespace := options.Parameters[ProvisionerSecretNamespaceParam]
+	if !hasName || !hasNamespace {
+		return "", "", false
+	}
+
+	return expandSecretTemplate(namespaceTemplate, options.PVC.Name, options.PVC.Namespace, ""),
+		expandSecretTemplate(nameTemplate, options.PVC.Name, options.PVC.Namespace, ""),
+		true
+}
+
+// getDeleteSecretReference mirrors getProvisionSecretReference for Delete,
+// where there is no StorageClass parameter map to read: the PV's ClaimRef
+// is the only remaining link back to the PVC (and therefore the
+// StorageClass parameters) that provisioned it.
+func getDeleteSecretReference(volume *v1.PersistentVolume, nameTemplate, namespaceTemplate string) (namespace, name string) {
+	claimRef := volume.Spec.ClaimRef
+	pvcName, pvcNamespace := "", ""
+	if claimRef != nil {
+		pvcName, pvcNamespace = claimRef.Name, claimRef.Namespace
+	}
+
+	return expandSecretTemplate(namespaceTemplate, pvcName, pvcNamespace, volume.Name),
+		expandSecretTemplate(nameTemplate, pvcName, pvcNamespace, volume.Name)
+}
+
+func expandSecretTemplate(template, pvcName, pvcNamespace, pvName string) string {
+	replacer := strings.NewReplacer(
+		"${pvc.name}", pvcName,
+		"${pvc.namespace}", pvcNamespace,
+		"${pv.name}", pvName,
+	)
+	return replacer.Replace(template)
+}
+
+// SecretRefAnnotationsForProvision returns the annotations that should be
+// set on a newly provisioned PV so that Delete can later re-resolve the
+// same per-call secret, or nil if the StorageClass did not reference one.
+func SecretRefAnnotationsForProvision(options controller.VolumeOptions) map[string]string {
+	nameTemplate, hasName := options.Parameters[ProvisionerSecretNameParam]
+	namespaceTemplate, hasNamespace := options.Parameters[ProvisionerSecretNamespaceParam]
+	if !hasName || !hasNamespace {
+		return nil
+	}
+
+	return map[string]string{
+		ProvisionerSecretNameAnnotation:      nameTemplate,
+		ProvisionerSecretNamespaceAnnotation: namespaceTemplate,
+	}
+}
+
+// configurationProviderFromSecret builds a per-call OCI
+// common.ConfigurationProvider out of the user/tenancy/fingerprint/region/
+// key material stored in a Secret's Data, overriding the ambient
+// ProvisionerClient credentials for a single Provision/Delete call.
+func configurationProviderFromSecret(secret *v1.Secret) (common.ConfigurationProvider, error) {
+	get := func(key string) (string, error) {
+		value, ok := secret.Data[key]
+		if !ok {
+			return "", fmt.Errorf("secret %s/%s is missing required key %q", secret.Namespace, secret.Name, key)
+		}
+		return string(value), nil
+	}
+
+	user, err := get(secretKeyUser)
+	if err != nil {
+		return nil, err
+	}
+	tenancy, err := get(secretKeyTenancy)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := get(secretKeyFingerprint)
+	if err != nil {
+		return nil, err
+	}
+	region, err := get(secretKeyRegion)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := get(secretKeyPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	passphrase := string(secret.Data[secretKeyPassphrase])
+
+	return common.NewRawConfigurationProvider(tenancy, user, region, fingerprint, privateKey, &passphrase), nil
+}
+
+// perCallProvisionerClient overrides the BlockStorage client a
+// ProvisionerClient authenticates with, while delegating CompartmentOCID/
+// Context/Timeout to the base (ambient) client.
+type perCallProvisionerClient struct {
+	ProvisionerClient
+	blockStorage core.BlockstorageClient
+}
+
+func (c *perCallProvisionerClient) BlockStorage() core.BlockstorageClient {
+	return c.blockStorage
+}
+
+func newPerCallProvisionerClient(base ProvisionerClient, cp common.ConfigurationProvider) (ProvisionerClient, error) {
+	blockStorage, err := core.NewBlockstorageClientWithConfigurationProvider(cp)
+	if err != nil {
+		return nil, err
+	}
+	return &perCallProvisionerClient{ProvisionerClient: base, blockStorage: blockStorage}, nil
+}
+
+// ResolveProvisionClient returns a ProvisionerClient using the credentials
+// referenced by a Provision call's provisioner-secret-name/
+// provisioner-secret-namespace StorageClass parameters, or nil if the
+// StorageClass does not reference one, in which case the caller should use
+// its ambient client.
+func ResolveProvisionClient(kubeClient kubernetes.Interface, base ProvisionerClient, options controller.VolumeOptions) (ProvisionerClient, error) {
+	namespace, name, ok := getProvisionSecretReference(options)
+	if !ok {
+		return nil, nil
+	}
+
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provisioner secret %s/%s: %v", namespace, name, err)
+	}
+
+	cp, err := configurationProviderFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPerCallProvisionerClient(base, cp)
+}
+
+// ResolveDeleteClient mirrors ResolveProvisionClient for Delete, re-resolving
+// the secret reference from the PV's ClaimRef and the provisioner-secret-*
+// templates stashed in volume's annotations at Provision time. Returns nil
+// if volume carries no such annotations.
+func ResolveDeleteClient(kubeClient kubernetes.Interface, base ProvisionerClient, volume *v1.PersistentVolume) (ProvisionerClient, error) {
+	nameTemplate, hasName := volume.Annotations[ProvisionerSecretNameAnnotation]
+	namespaceTemplate, hasNamespace := volume.Annotations[ProvisionerSecretNamespaceAnnotation]
+	if !hasName || !hasNamespace {
+		return nil, nil
+	}
+
+	namespace, name := getDeleteSecretReference(volume, nameTemplate, namespaceTemplate)
+
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provisioner secret %s/%s: %v", namespace, name, err)
+	}
+
+	cp, err := configurationProviderFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPerCallProvisionerClient(base, cp)
+}
@@ -20,13 +20,16 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/golang/glog"
 	"github.com/kubernetes-incubator/external-storage/lib/controller"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/oracle/oci-go-sdk/common"
 	"github.com/oracle/oci-go-sdk/core"
@@ -45,6 +48,10 @@ const (
 	defaultTagsEnvVar      = "OCI_DEFAULT_TAGS"
 	volumePrefixEnvVarName = "OCI_VOLUME_NAME_PREFIX"
 	fsType                 = "fsType"
+
+	vpusPerGBParam      = "vpusPerGB"
+	kmsKeyIDParam       = "kmsKeyId"
+	backupPolicyIDParam = "backupPolicyId"
 )
 
 // blockProvisioner is the internal provisioner for OCI block volumes
@@ -53,18 +60,119 @@ type blockProvisioner struct {
 	metadata              instancemeta.Interface
 	volumeRoundingEnabled bool
 	minVolumeSize         resource.Quantity
+	// recorder surfaces provisioning failures as events on the PVC, the
+	// same way the upstream PV controller does for in-tree plugins.
+	recorder record.EventRecorder
+	// kubeClient resolves the Secrets referenced by a StorageClass's
+	// provisioner-secret-name/provisioner-secret-namespace parameters, for
+	// per-call credential overrides. May be nil if no StorageClass in the
+	// cluster uses them.
+	kubeClient kubernetes.Interface
 }
 
 var _ plugin.ProvisionerPlugin = &blockProvisioner{}
 
+func init() {
+	plugin.RegisterPlugin(plugin.BlockProvisionerName, newBlockProvisionerPlugin)
+}
+
+// newBlockProvisionerPlugin adapts NewBlockProvisioner to plugin.Factory so
+// that the block backend is discovered by plugin.ProbeVolumePlugins rather
+// than by a hard-coded switch in main.
+func newBlockProvisionerPlugin(config plugin.FactoryConfig) (plugin.ProvisionerPlugin, error) {
+	return NewBlockProvisioner(config.Client, config.Metadata, config.VolumeRoundingEnabled, config.MinVolumeSize, config.Recorder, config.KubeClient), nil
+}
+
 // NewBlockProvisioner creates a new instance of the block storage provisioner
-func NewBlockProvisioner(client client.ProvisionerClient, metadata instancemeta.Interface, volumeRoundingEnabled bool, minVolumeSize resource.Quantity) plugin.ProvisionerPlugin {
+func NewBlockProvisioner(client client.ProvisionerClient, metadata instancemeta.Interface, volumeRoundingEnabled bool, minVolumeSize resource.Quantity, recorder record.EventRecorder, kubeClient kubernetes.Interface) plugin.ProvisionerPlugin {
 	return &blockProvisioner{
 		client:                client,
 		metadata:              metadata,
 		volumeRoundingEnabled: volumeRoundingEnabled,
 		minVolumeSize:         minVolumeSize,
+		recorder:              recorder,
+		kubeClient:            kubeClient,
+	}
+}
+
+// provisionerClientFor returns the ProvisionerClient a single Provision call
+// should use: the per-call client referenced by the StorageClass's
+// provisioner-secret-name/provisioner-secret-namespace parameters if set,
+// otherwise block.client.
+func (block *blockProvisioner) provisionerClientFor(options controller.VolumeOptions) (client.ProvisionerClient, error) {
+	if block.kubeClient == nil {
+		return block.client, nil
+	}
+
+	override, err := client.ResolveProvisionClient(block.kubeClient, block.client, options)
+	if err != nil {
+		return nil, err
 	}
+	if override != nil {
+		return override, nil
+	}
+
+	return block.client, nil
+}
+
+// provisionerClientForDelete mirrors provisionerClientFor for Delete and
+// Expand, which only ever see the PV, re-resolving the same secret via
+// volume's provisioner-secret-* annotations and ClaimRef.
+func (block *blockProvisioner) provisionerClientForDelete(volume *v1.PersistentVolume) (client.ProvisionerClient, error) {
+	if block.kubeClient == nil {
+		return block.client, nil
+	}
+
+	override, err := client.ResolveDeleteClient(block.kubeClient, block.client, volume)
+	if err != nil {
+		return nil, err
+	}
+	if override != nil {
+		return override, nil
+	}
+
+	return block.client, nil
+}
+
+// recordEvent surfaces a provisioning failure as an event on the PVC so
+// that `kubectl describe pvc` shows operators why provisioning failed,
+// instead of only the controller logs.
+func (block *blockProvisioner) recordEvent(pvc *v1.PersistentVolumeClaim, eventType, reason, message string) {
+	if block.recorder == nil {
+		return
+	}
+	block.recorder.Event(pvc, eventType, reason, message)
+}
+
+// assignBackupPolicy attaches an OCI backup policy to a newly created
+// volume. Called after CreateVolume succeeds; on failure the caller is
+// expected to roll back the volume since a PV wouldn't otherwise get the
+// backup policy it was asked for.
+func (block *blockProvisioner) assignBackupPolicy(ociClient client.ProvisionerClient, volumeID, backupPolicyID string) error {
+	ctx, cancel := context.WithTimeout(ociClient.Context(), ociClient.Timeout())
+	defer cancel()
+
+	_, err := ociClient.BlockStorage().CreateVolumeBackupPolicyAssignment(ctx, core.CreateVolumeBackupPolicyAssignmentRequest{
+		CreateVolumeBackupPolicyAssignmentDetails: core.CreateVolumeBackupPolicyAssignmentDetails{
+			AssetId:  common.String(volumeID),
+			PolicyId: common.String(backupPolicyID),
+		},
+	})
+	return err
+}
+
+// deleteVolume deletes a raw OCI volume ID via ociClient, skipping 404s the
+// same way Delete does. Used both by Delete and by Provision's backup
+// policy rollback path, where there is no PV object yet to call Delete with.
+func (block *blockProvisioner) deleteVolume(ociClient client.ProvisionerClient, volumeID string) error {
+	ctx, cancel := context.WithTimeout(ociClient.Context(), ociClient.Timeout())
+	defer cancel()
+
+	response, err := ociClient.BlockStorage().DeleteVolume(ctx, core.DeleteVolumeRequest{VolumeId: common.String(volumeID)})
+	if response.RawResponse != nil && response.RawResponse.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
 }
 
 func mapVolumeIDToName(volumeID string) string {
@@ -79,10 +187,116 @@ func resolveFSType(options controller.VolumeOptions) string {
 	return fs
 }
 
+// volumeParameters are the StorageClass parameters that map directly onto
+// OCI CreateVolumeDetails fields (or a follow-up call made once the volume
+// exists), resolved and validated up front so that Provision itself only
+// has to deal with well-formed values.
+type volumeParameters struct {
+	// VpusPerGB selects the volume's performance tier: 0 is Lower Cost,
+	// 10 is Balanced, 20 is Higher Performance, and 30-120 (in increments
+	// of 10) is Ultra High Performance.
+	VpusPerGB *int64
+	// KmsKeyID, if set, is the OCID of the KMS key used to encrypt the
+	// volume with a customer-managed key instead of an Oracle-managed one.
+	KmsKeyID string
+	// BackupPolicyID, if set, is the OCID of the backup policy to assign
+	// to the volume once it has been created.
+	BackupPolicyID string
+}
+
+// resolveVolumeParameters validates the performance-tier/encryption/backup
+// policy StorageClass parameters, alongside resolveFSType.
+func resolveVolumeParameters(options controller.VolumeOptions) (volumeParameters, error) {
+	params := volumeParameters{}
+
+	if value, ok := options.Parameters[vpusPerGBParam]; ok {
+		vpusPerGB, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return params, fmt.Errorf("invalid %s %q: %v", vpusPerGBParam, value, err)
+		}
+		if vpusPerGB != 0 && vpusPerGB != 10 && (vpusPerGB < 20 || vpusPerGB > 120 || vpusPerGB%10 != 0) {
+			return params, fmt.Errorf("invalid %s %q: must be 0 (Lower Cost), 10 (Balanced), 20 (Higher Performance), or a multiple of 10 from 30-120 (Ultra High Performance)", vpusPerGBParam, value)
+		}
+		params.VpusPerGB = common.Int64(vpusPerGB)
+	}
+
+	params.KmsKeyID = options.Parameters[kmsKeyIDParam]
+	params.BackupPolicyID = options.Parameters[backupPolicyIDParam]
+
+	return params, nil
+}
+
 func roundUpSize(volumeSizeBytes int64, allocationUnitBytes int64) int64 {
 	return (volumeSizeBytes + allocationUnitBytes - 1) / allocationUnitBytes
 }
 
+// resolveAvailabilityDomain returns the AD the volume should be created in.
+// Block volumes are AD-local, so when the StorageClass uses
+// volumeBindingMode: WaitForFirstConsumer we must not create the volume
+// until the scheduler has picked a node, and then we must create it in that
+// node's AD rather than the caller-supplied default. ad is returned
+// unchanged when the controller library hasn't resolved a SelectedNode,
+// i.e. the (default) Immediate binding mode.
+func (block *blockProvisioner) resolveAvailabilityDomain(options controller.VolumeOptions, ad *identity.AvailabilityDomain) (*identity.AvailabilityDomain, error) {
+	if options.SelectedNode == nil {
+		return ad, nil
+	}
+
+	adName, ok := options.SelectedNode.Labels[plugin.LabelZoneFailureDomain]
+	if !ok {
+		return nil, fmt.Errorf("selected node %q has no %q label", options.SelectedNode.Name, plugin.LabelZoneFailureDomain)
+	}
+
+	if err := checkAllowedTopologies(options.AllowedTopologies, options.SelectedNode.Labels); err != nil {
+		return nil, err
+	}
+
+	return &identity.AvailabilityDomain{Name: common.String(adName)}, nil
+}
+
+// checkAllowedTopologies rejects a selected node that doesn't satisfy the
+// StorageClass's allowedTopologies, mirroring how the upstream persistent
+// volume controller enforces allowedTopologies for in-tree plugins: allowed
+// is in disjunctive normal form, so the node must match every
+// MatchLabelExpression within at least one term (AND within a term, OR
+// across terms), not just the zone expression.
+func checkAllowedTopologies(allowed []v1.TopologySelectorTerm, nodeLabels map[string]string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	adName := nodeLabels[plugin.LabelZoneFailureDomain]
+
+	for _, term := range allowed {
+		if termMatches(term, nodeLabels) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("AD %q is not permitted by allowedTopologies", adName)
+}
+
+// termMatches reports whether nodeLabels satisfies every MatchLabelExpression
+// in term.
+func termMatches(term v1.TopologySelectorTerm, nodeLabels map[string]string) bool {
+	for _, expr := range term.MatchLabelExpressions {
+		value, ok := nodeLabels[expr.Key]
+		if !ok || !containsString(expr.Values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // Provision creates an OCI block volume
 func (block *blockProvisioner) Provision(options controller.VolumeOptions, ad *identity.AvailabilityDomain) (*v1.PersistentVolume, error) {
 	for _, accessMode := range options.PVC.Spec.AccessModes {
@@ -91,6 +305,17 @@ func (block *blockProvisioner) Provision(options controller.VolumeOptions, ad *i
 		}
 	}
 
+	ad, err := block.resolveAvailabilityDomain(options, ad)
+	if err != nil {
+		return nil, err
+	}
+
+	ociClient, err := block.provisionerClientFor(options)
+	if err != nil {
+		block.recordEvent(options.PVC, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+		return nil, err
+	}
+
 	// Calculate the volume size
 	capacity, ok := options.PVC.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)]
 	if !ok {
@@ -107,13 +332,24 @@ func (block *blockProvisioner) Provision(options controller.VolumeOptions, ad *i
 		capacity = block.minVolumeSize
 	}
 
-	glog.Infof("Creating volume size=%v AD=%s compartmentOCID=%q", volSizeMB, *ad.Name, block.client.CompartmentOCID())
+	glog.Infof("Creating volume size=%v AD=%s compartmentOCID=%q", volSizeMB, *ad.Name, ociClient.CompartmentOCID())
+
+	volParams, err := resolveVolumeParameters(options)
+	if err != nil {
+		block.recordEvent(options.PVC, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+		return nil, err
+	}
 
 	volumeDetails := core.CreateVolumeDetails{
 		AvailabilityDomain: ad.Name,
-		CompartmentId:      common.String(block.client.CompartmentOCID()),
+		CompartmentId:      common.String(ociClient.CompartmentOCID()),
 		DisplayName:        common.String(fmt.Sprintf("%s%s", os.Getenv(volumePrefixEnvVarName), options.PVC.Name)),
 		SizeInMBs:          common.Int(volSizeMB),
+		VpusPerGB:          volParams.VpusPerGB,
+	}
+
+	if volParams.KmsKeyID != "" {
+		volumeDetails.KmsKeyId = common.String(volParams.KmsKeyID)
 	}
 
 	definedTags, freeformTags, err := getTags(options.PVC.Annotations)
@@ -129,20 +365,31 @@ func (block *blockProvisioner) Provision(options controller.VolumeOptions, ad *i
 		volumeDetails.SourceDetails = &core.VolumeSourceFromVolumeBackupDetails{Id: &value}
 	}
 
-	ctx, cancel := context.WithTimeout(block.client.Context(), block.client.Timeout())
+	ctx, cancel := context.WithTimeout(ociClient.Context(), ociClient.Timeout())
 	defer cancel()
 	prefix := strings.TrimSpace(os.Getenv(volumePrefixEnvVarName))
 	if prefix != "" && !strings.HasSuffix(prefix, "-") {
 		prefix = fmt.Sprintf("%s%s", prefix, "-")
 	}
 
-	newVolume, err := block.client.BlockStorage().CreateVolume(ctx, core.CreateVolumeRequest{
+	newVolume, err := ociClient.BlockStorage().CreateVolume(ctx, core.CreateVolumeRequest{
 		CreateVolumeDetails: volumeDetails,
 	})
 	if err != nil {
+		block.recordEvent(options.PVC, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
 		return nil, err
 	}
 
+	if volParams.BackupPolicyID != "" {
+		if err := block.assignBackupPolicy(ociClient, *newVolume.Id, volParams.BackupPolicyID); err != nil {
+			block.recordEvent(options.PVC, v1.EventTypeWarning, "ProvisioningFailed", fmt.Sprintf("failed to assign backup policy %s, rolling back volume: %v", volParams.BackupPolicyID, err))
+			if delErr := block.deleteVolume(ociClient, *newVolume.Id); delErr != nil {
+				glog.Errorf("failed to roll back volume %s after failed backup policy assignment: %v", *newVolume.Id, delErr)
+			}
+			return nil, err
+		}
+	}
+
 	filesystemType := resolveFSType(options)
 
 	region, ok := os.LookupEnv("OCI_SHORT_REGION")
@@ -156,10 +403,8 @@ func (block *blockProvisioner) Provision(options controller.VolumeOptions, ad *i
 
 	pv := &v1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: *newVolume.Id,
-			Annotations: map[string]string{
-				ociVolumeID: *newVolume.Id,
-			},
+			Name:        *newVolume.Id,
+			Annotations: pvAnnotations(*newVolume.Id, options),
 			Labels: map[string]string{
 				plugin.LabelZoneRegion:        region,
 				plugin.LabelZoneFailureDomain: *ad.Name,
@@ -177,12 +422,52 @@ func (block *blockProvisioner) Provision(options controller.VolumeOptions, ad *i
 					FSType: filesystemType,
 				},
 			},
+			NodeAffinity: nodeAffinityForTopology(region, *ad.Name),
 		},
 	}
 
 	return pv, nil
 }
 
+// pvAnnotations returns the annotations a newly provisioned PV needs: the
+// volume ID Delete/Expand key off, plus the provisioner-secret-* annotations
+// (if any) Delete needs to re-resolve the same per-call credentials.
+func pvAnnotations(volumeID string, options controller.VolumeOptions) map[string]string {
+	annotations := map[string]string{
+		ociVolumeID: volumeID,
+	}
+	for key, value := range client.SecretRefAnnotationsForProvision(options) {
+		annotations[key] = value
+	}
+	return annotations
+}
+
+// nodeAffinityForTopology constrains a PV to nodes in the same
+// region/AD the OCI block volume was created in, so that the scheduler
+// will only bind pods to nodes that can actually attach it.
+func nodeAffinityForTopology(region, adName string) *v1.VolumeNodeAffinity {
+	return &v1.VolumeNodeAffinity{
+		Required: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{
+					MatchExpressions: []v1.NodeSelectorRequirement{
+						{
+							Key:      plugin.LabelZoneRegion,
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{region},
+						},
+						{
+							Key:      plugin.LabelZoneFailureDomain,
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{adName},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 func getTags(annotations map[string]string) (defined map[string]map[string]interface{}, freeform map[string]string, err error) {
 	defaultDefinedTags, defaultFreeformTags, err := parseTags(os.Getenv(defaultTagsEnvVar))
 	if err != nil {
@@ -257,16 +542,64 @@ func (block *blockProvisioner) Delete(volume *v1.PersistentVolume) error {
 	}
 	glog.Infof("Deleting volume %v with volumeId %v", volume, volID)
 
-	request := core.DeleteVolumeRequest{VolumeId: common.String(volID)}
-	ctx, cancel := context.WithTimeout(block.client.Context(), block.client.Timeout())
-	defer cancel()
+	ociClient, err := block.provisionerClientForDelete(volume)
+	if err != nil {
+		return err
+	}
 
-	response, err := block.client.BlockStorage().DeleteVolume(ctx, request)
-	// If the volume does not exists (perhaps a user deleted it) then stop retrying the delete
+	// If the volume does not exists (perhaps a user deleted it) then stop retrying the delete.
 	// Note that we cannot differentiate between a volume that no longer exists and an authentication failure.
-	if response.RawResponse != nil && response.RawResponse.StatusCode == http.StatusNotFound {
-		return nil
+	return block.deleteVolume(ociClient, volID)
+}
+
+// minOCIVolumeSizeGB is the smallest block volume size OCI will provision,
+// regardless of what minVolumeSize/volumeRoundingEnabled resolve to.
+const minOCIVolumeSizeGB = 50
+
+var _ plugin.ExpanderPlugin = &blockProvisioner{}
+
+// Expand resizes the OCI block volume backing volume to newSize, returning
+// the size it was actually resized to. OCI applies resizes to the volume
+// itself synchronously, but the filesystem on top of it is only grown when
+// the flexvolume driver next attaches/remounts it, so Expand always returns
+// false for the "resize complete" bool: callers must set
+// FileSystemResizePending on the PVC and let the node finish the job.
+func (block *blockProvisioner) Expand(volume *v1.PersistentVolume, newSize resource.Quantity) (resource.Quantity, bool, error) {
+	volID, ok := volume.Annotations[ociVolumeID]
+	if !ok {
+		return resource.Quantity{}, false, errors.New("volumeid annotation not found on PV")
 	}
 
-	return err
+	if block.volumeRoundingEnabled && block.minVolumeSize.Cmp(newSize) == 1 {
+		newSize = block.minVolumeSize
+	}
+
+	newSizeGB := int(roundUpSize(newSize.Value(), 1024*1024*1024))
+	if newSizeGB < minOCIVolumeSizeGB {
+		glog.Warningf("requested size %dGB for volume %v is below the OCI minimum of %dGB; rounding up", newSizeGB, volID, minOCIVolumeSizeGB)
+		newSizeGB = minOCIVolumeSizeGB
+	}
+
+	glog.Infof("Expanding volume %v to %dGB", volID, newSizeGB)
+
+	ociClient, err := block.provisionerClientForDelete(volume)
+	if err != nil {
+		return resource.Quantity{}, false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ociClient.Context(), ociClient.Timeout())
+	defer cancel()
+
+	_, err = ociClient.BlockStorage().UpdateVolume(ctx, core.UpdateVolumeRequest{
+		VolumeId: common.String(volID),
+		UpdateVolumeDetails: core.UpdateVolumeDetails{
+			SizeInGBs: common.Int(newSizeGB),
+		},
+	})
+	if err != nil {
+		return resource.Quantity{}, false, err
+	}
+
+	actual := resource.MustParse(fmt.Sprintf("%dGi", newSizeGB))
+	return actual, false, nil
 }
@@ -0,0 +1,107 @@
+// Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package block
+
+import (
+	"testing"
+
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/oracle/oci-volume-provisioner/pkg/provisioner/plugin"
+)
+
+func TestCheckAllowedTopologies(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []v1.TopologySelectorTerm
+		nodeLabels map[string]string
+		wantErr    bool
+	}{
+		{
+			name:       "no allowedTopologies",
+			nodeLabels: map[string]string{plugin.LabelZoneFailureDomain: "PHX-AD-1"},
+		},
+		{
+			name: "zone matches single-expression term",
+			allowed: []v1.TopologySelectorTerm{
+				{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+					{Key: plugin.LabelZoneFailureDomain, Values: []string{"PHX-AD-1", "PHX-AD-2"}},
+				}},
+			},
+			nodeLabels: map[string]string{plugin.LabelZoneFailureDomain: "PHX-AD-1"},
+		},
+		{
+			name: "zone not listed",
+			allowed: []v1.TopologySelectorTerm{
+				{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+					{Key: plugin.LabelZoneFailureDomain, Values: []string{"PHX-AD-2"}},
+				}},
+			},
+			nodeLabels: map[string]string{plugin.LabelZoneFailureDomain: "PHX-AD-1"},
+			wantErr:    true,
+		},
+		{
+			name: "zone matches but region in the same term does not",
+			allowed: []v1.TopologySelectorTerm{
+				{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+					{Key: plugin.LabelZoneFailureDomain, Values: []string{"PHX-AD-1"}},
+					{Key: plugin.LabelZoneRegion, Values: []string{"us-ashburn-1"}},
+				}},
+			},
+			nodeLabels: map[string]string{
+				plugin.LabelZoneFailureDomain: "PHX-AD-1",
+				plugin.LabelZoneRegion:        "us-phoenix-1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "zone and region both match the same term",
+			allowed: []v1.TopologySelectorTerm{
+				{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+					{Key: plugin.LabelZoneFailureDomain, Values: []string{"PHX-AD-1"}},
+					{Key: plugin.LabelZoneRegion, Values: []string{"us-phoenix-1"}},
+				}},
+			},
+			nodeLabels: map[string]string{
+				plugin.LabelZoneFailureDomain: "PHX-AD-1",
+				plugin.LabelZoneRegion:        "us-phoenix-1",
+			},
+		},
+		{
+			name: "second term matches when first does not",
+			allowed: []v1.TopologySelectorTerm{
+				{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+					{Key: plugin.LabelZoneFailureDomain, Values: []string{"PHX-AD-2"}},
+				}},
+				{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+					{Key: plugin.LabelZoneFailureDomain, Values: []string{"PHX-AD-1"}},
+				}},
+			},
+			nodeLabels: map[string]string{plugin.LabelZoneFailureDomain: "PHX-AD-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAllowedTopologies(tt.allowed, tt.nodeLabels)
+			if tt.wantErr && err == nil {
+				t.Fatalf("checkAllowedTopologies(): expected error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("checkAllowedTopologies(): unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package block
+
+import (
+	"testing"
+
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+)
+
+func TestResolveVolumeParametersVpusPerGB(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "unset", value: ""},
+		{name: "lower cost", value: "0"},
+		{name: "balanced", value: "10"},
+		{name: "higher performance", value: "20"},
+		{name: "ultra high performance floor", value: "30"},
+		{name: "ultra high performance mid", value: "60"},
+		{name: "ultra high performance ceiling", value: "120"},
+		{name: "above ultra high performance ceiling", value: "130", wantErr: true},
+		{name: "between tiers", value: "25", wantErr: true},
+		{name: "not a multiple of 10 above 20", value: "35", wantErr: true},
+		{name: "negative", value: "-10", wantErr: true},
+		{name: "not a number", value: "banana", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := controller.VolumeOptions{Parameters: map[string]string{}}
+			if tt.value != "" {
+				options.Parameters[vpusPerGBParam] = tt.value
+			}
+
+			params, err := resolveVolumeParameters(options)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveVolumeParameters(%q): expected error, got none", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveVolumeParameters(%q): unexpected error: %v", tt.value, err)
+			}
+			if tt.value == "" {
+				if params.VpusPerGB != nil {
+					t.Fatalf("resolveVolumeParameters(%q): expected nil VpusPerGB, got %v", tt.value, *params.VpusPerGB)
+				}
+				return
+			}
+			if params.VpusPerGB == nil {
+				t.Fatalf("resolveVolumeParameters(%q): expected non-nil VpusPerGB", tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expand implements the PVC-watching controller that drives OCI
+// volume expansion: when a bound PVC's spec.resources.requests.storage is
+// raised past its PV's current capacity, it calls the backend's
+// plugin.ExpanderPlugin.Expand, patches the PV's capacity to match, and (for
+// backends that can't finish the resize synchronously) marks the PVC
+// FileSystemResizePending so the node-side flexvolume driver finishes the
+// filesystem resize on next mount, the same way upstream Kubernetes'
+// in-tree expand controller does for in-tree plugins.
+//
+// Controller has no caller in this tree yet: like pkg/provisioner/plugin's
+// registry, it is meant to be started from a main.go that isn't part of
+// this chunk.
+package expand
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/oracle/oci-volume-provisioner/pkg/provisioner/plugin"
+)
+
+const (
+	// resyncPeriod re-lists PVCs periodically as a backstop against missed
+	// watch events, the same way the upstream PV controller does.
+	resyncPeriod = 15 * time.Minute
+	maxRetries   = 10
+
+	// provisionedByAnnotation is the well-known annotation the external
+	// dynamic provisioner library stamps onto a PV recording which
+	// StorageClass `provisioner` created it, used here to pick the right
+	// backend's ExpanderPlugin for a PV without re-reading its StorageClass.
+	provisionedByAnnotation = "pv.kubernetes.io/provisioned-by"
+
+	reasonResizeFailed  = "VolumeResizeFailed"
+	reasonResizeSuccess = "VolumeResizeSuccessful"
+)
+
+// Controller watches PersistentVolumeClaims and drives OCI volume expansion
+// for ones that request more storage than their bound PV currently has.
+type Controller struct {
+	kubeClient kubernetes.Interface
+	recorder   record.EventRecorder
+	// plugins are keyed by the StorageClass `provisioner` name recorded in
+	// a PV's provisionedByAnnotation. A provisioner name missing from this
+	// map (or whose backend doesn't implement plugin.ExpanderPlugin) is
+	// silently ignored, the same way upstream skips in-tree plugins that
+	// don't support expansion.
+	plugins map[string]plugin.ExpanderPlugin
+
+	pvcIndexer  cache.Indexer
+	pvcInformer cache.Controller
+	queue       workqueue.RateLimitingInterface
+}
+
+// NewController creates a Controller. plugins should contain one entry per
+// StorageClass `provisioner` name that supports resize, i.e. whose backend
+// implements plugin.ExpanderPlugin. Call Run to start it.
+func NewController(kubeClient kubernetes.Interface, recorder record.EventRecorder, plugins map[string]plugin.ExpanderPlugin) *Controller {
+	c := &Controller{
+		kubeClient: kubeClient,
+		recorder:   recorder,
+		plugins:    plugins,
+		queue:      workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+
+	c.pvcIndexer, c.pvcInformer = cache.NewIndexerInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return kubeClient.CoreV1().PersistentVolumeClaims(v1.NamespaceAll).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return kubeClient.CoreV1().PersistentVolumeClaims(v1.NamespaceAll).Watch(options)
+			},
+		},
+		&v1.PersistentVolumeClaim{},
+		resyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.enqueue,
+			UpdateFunc: func(old, new interface{}) { c.enqueue(new) },
+		},
+		cache.Indexers{},
+	)
+
+	return c
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("failed to compute key for %v: %v", obj, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// Run starts the controller and blocks until stopCh is closed.
+func (c *Controller) Run(workers int, stopCh <-chan struct{}) {
+	defer c.queue.ShutDown()
+
+	glog.Info("Starting PVC resize controller")
+	go c.pvcInformer.Run(stopCh)
+
+	if !cache.WaitForCacheSync(stopCh, c.pvcInformer.HasSynced) {
+		glog.Error("timed out waiting for PVC cache to sync")
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	<-stopCh
+	glog.Info("Stopping PVC resize controller")
+}
+
+func (c *Controller) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+func (c *Controller) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.reconcile(key.(string))
+	c.handleErr(err, key)
+	return true
+}
+
+func (c *Controller) handleErr(err error, key interface{}) {
+	if err == nil {
+		c.queue.Forget(key)
+		return
+	}
+
+	if c.queue.NumRequeues(key) < maxRetries {
+		glog.Warningf("error resizing PVC %v, retrying: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return
+	}
+
+	glog.Errorf("giving up resizing PVC %v after %d retries: %v", key, maxRetries, err)
+	c.queue.Forget(key)
+}
+
+// reconcile resizes the OCI volume backing the PVC named by key, if it is
+// bound and its requested size has grown past its PV's current capacity.
+func (c *Controller) reconcile(key string) error {
+	obj, exists, err := c.pvcIndexer.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	pvc := obj.(*v1.PersistentVolumeClaim)
+
+	if pvc.Spec.VolumeName == "" {
+		// Not bound yet; nothing to expand.
+		return nil
+	}
+
+	requested, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	if !ok {
+		return nil
+	}
+
+	pv, err := c.kubeClient.CoreV1().PersistentVolumes().Get(pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	current, ok := pv.Spec.Capacity[v1.ResourceStorage]
+	if !ok || requested.Cmp(current) <= 0 {
+		// Already at or above the requested size.
+		return nil
+	}
+
+	expander, ok := c.plugins[pv.Annotations[provisionedByAnnotation]]
+	if !ok {
+		return nil
+	}
+
+	newSize, resizeComplete, err := expander.Expand(pv, requested)
+	if err != nil {
+		c.recorder.Event(pvc, v1.EventTypeWarning, reasonResizeFailed, err.Error())
+		return err
+	}
+
+	pv.Spec.Capacity[v1.ResourceStorage] = newSize
+	if _, err := c.kubeClient.CoreV1().PersistentVolumes().Update(pv); err != nil {
+		return err
+	}
+	c.recorder.Event(pvc, v1.EventTypeNormal, reasonResizeSuccess, fmt.Sprintf("Resized volume to %s", newSize.String()))
+
+	if resizeComplete {
+		return nil
+	}
+
+	return c.setFileSystemResizePending(pvc)
+}
+
+// setFileSystemResizePending sets (or refreshes) the
+// PersistentVolumeClaimFileSystemResizePending condition on pvc so that the
+// node-side flexvolume driver knows to finish growing the filesystem on
+// next mount/remount.
+func (c *Controller) setFileSystemResizePending(pvc *v1.PersistentVolumeClaim) error {
+	updated := pvc.DeepCopy()
+	condition := v1.PersistentVolumeClaimCondition{
+		Type:               v1.PersistentVolumeClaimFileSystemResizePending,
+		Status:             v1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Message:            "Waiting for user to (re-)start a pod to finish file system resize of volume on node.",
+	}
+	updated.Status.Conditions = mergeResizeCondition(updated.Status.Conditions, condition)
+
+	_, err := c.kubeClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).UpdateStatus(updated)
+	return err
+}
+
+func mergeResizeCondition(conditions []v1.PersistentVolumeClaimCondition, newCondition v1.PersistentVolumeClaimCondition) []v1.PersistentVolumeClaimCondition {
+	for i, existing := range conditions {
+		if existing.Type == newCondition.Type {
+			conditions[i] = newCondition
+			return conditions
+		}
+	}
+	return append(conditions, newCondition)
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fss is a stub ProvisionerPlugin for OCI File Storage Service
+// volumes, registered under the "oracle.com/oci-fss" provisioner name so
+// that it is discoverable the same way the block backend is. It exists so
+// StorageClasses naming it fail with a clear "not implemented" error
+// instead of an unknown-provisioner error, until FSS support lands.
+package fss
+
+import (
+	"fmt"
+
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"github.com/oracle/oci-go-sdk/identity"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/oracle/oci-volume-provisioner/pkg/provisioner/plugin"
+)
+
+func init() {
+	plugin.RegisterPlugin(plugin.FSSProvisionerName, newFilesystemProvisionerPlugin)
+}
+
+func newFilesystemProvisionerPlugin(config plugin.FactoryConfig) (plugin.ProvisionerPlugin, error) {
+	return &filesystemProvisioner{}, nil
+}
+
+// filesystemProvisioner is a stub backend for OCI FSS volumes.
+type filesystemProvisioner struct{}
+
+var _ plugin.ProvisionerPlugin = &filesystemProvisioner{}
+
+// Provision is not yet implemented.
+func (f *filesystemProvisioner) Provision(options controller.VolumeOptions, ad *identity.AvailabilityDomain) (*v1.PersistentVolume, error) {
+	return nil, fmt.Errorf("%s: FSS provisioning is not yet implemented", plugin.FSSProvisionerName)
+}
+
+// Delete is not yet implemented.
+func (f *filesystemProvisioner) Delete(volume *v1.PersistentVolume) error {
+	return fmt.Errorf("%s: FSS deletion is not yet implemented", plugin.FSSProvisionerName)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2017, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin defines the interface between the provisioner main loop and
+// the concrete per-backend (block, FSS, ...) implementations.
+package plugin
+
+import (
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"github.com/oracle/oci-go-sdk/identity"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// OCIProvisionerName is the name of the flexvolume driver used by the
+	// OCI block volume provisioner.
+	OCIProvisionerName = "oracle/oci"
+
+	// BlockProvisionerName is the StorageClass `provisioner` name that
+	// selects the block volume backend.
+	BlockProvisionerName = "oracle.com/oci"
+	// FSSProvisionerName is the StorageClass `provisioner` name that
+	// selects the (currently stubbed) FSS backend.
+	FSSProvisionerName = "oracle.com/oci-fss"
+
+	// LabelZoneRegion is the well-known label populated with the OCI region
+	// a PV was provisioned in.
+	LabelZoneRegion = "failure-domain.beta.kubernetes.io/region"
+	// LabelZoneFailureDomain is the well-known label populated with the OCI
+	// availability domain a PV was provisioned in.
+	LabelZoneFailureDomain = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// ProvisionerPlugin is the interface implemented by each backend (block,
+// FSS, ...) so that the provisioner main loop can treat them uniformly.
+type ProvisionerPlugin interface {
+	// Provision creates a volume i.e. the storage asset and returns a PV
+	// object for the volume.
+	Provision(options controller.VolumeOptions, ad *identity.AvailabilityDomain) (*v1.PersistentVolume, error)
+	// Delete removes the storage asset that was created by Provision
+	// backing the given PV.
+	Delete(volume *v1.PersistentVolume) error
+}
+
+// ExpanderPlugin is implemented by backends that support resizing an
+// existing volume in place. A backend that does not support resize simply
+// does not implement this interface, so type-asserting its
+// ProvisionerPlugin against ExpanderPlugin fails.
+type ExpanderPlugin interface {
+	// Expand resizes the volume backing the given PV to newSize, returning
+	// the actual size the volume was resized to (which may be rounded up)
+	// and whether the resize completed synchronously. When the returned
+	// bool is false, the caller is expected to set FileSystemResizePending
+	// on the bound PVC so that the node-side flexvolume driver can finish
+	// the filesystem resize on next mount/remount.
+	Expand(volume *v1.PersistentVolume, newSize resource.Quantity) (resource.Quantity, bool, error)
+}
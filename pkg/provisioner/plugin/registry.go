@@ -0,0 +1,75 @@
+// Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/oracle/oci-volume-provisioner/pkg/oci/client"
+	"github.com/oracle/oci-volume-provisioner/pkg/oci/instancemeta"
+)
+
+// FactoryConfig bundles the dependencies a backend needs to build a
+// ProvisionerPlugin, so that adding a dependency one backend needs doesn't
+// change every other backend's factory signature.
+type FactoryConfig struct {
+	Client                client.ProvisionerClient
+	KubeClient            kubernetes.Interface
+	Metadata              instancemeta.Interface
+	Recorder              record.EventRecorder
+	VolumeRoundingEnabled bool
+	MinVolumeSize         resource.Quantity
+}
+
+// Factory builds a ProvisionerPlugin for a single backend (block, FSS, ...).
+type Factory func(FactoryConfig) (ProvisionerPlugin, error)
+
+var (
+	pluginsMutex sync.Mutex
+	plugins      = map[string]Factory{}
+)
+
+// RegisterPlugin registers a backend's Factory under the StorageClass
+// `provisioner` name that selects it (e.g. "oracle.com/oci"). Backends call
+// this from an init() function so that simply blank-importing the backend
+// package is enough to make it discoverable via ProbeVolumePlugins,
+// mirroring how Kubernetes' VolumePluginMgr is populated.
+func RegisterPlugin(name string, factory Factory) {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+
+	if _, found := plugins[name]; found {
+		panic(fmt.Sprintf("volume plugin %q was registered twice", name))
+	}
+	plugins[name] = factory
+}
+
+// ProbeVolumePlugins returns every backend Factory registered so far, keyed
+// by StorageClass `provisioner` name. Called once from main during startup.
+func ProbeVolumePlugins() map[string]Factory {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+
+	out := make(map[string]Factory, len(plugins))
+	for name, factory := range plugins {
+		out[name] = factory
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import "testing"
+
+func noopFactory(FactoryConfig) (ProvisionerPlugin, error) {
+	return nil, nil
+}
+
+func TestRegisterPluginPanicsOnDuplicateName(t *testing.T) {
+	const name = "test.oracle.com/duplicate"
+
+	defer func() {
+		pluginsMutex.Lock()
+		delete(plugins, name)
+		pluginsMutex.Unlock()
+	}()
+
+	RegisterPlugin(name, noopFactory)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("RegisterPlugin: expected panic registering %q twice, got none", name)
+		}
+	}()
+	RegisterPlugin(name, noopFactory)
+}
+
+func TestProbeVolumePluginsReturnsRegisteredFactories(t *testing.T) {
+	const name = "test.oracle.com/probe"
+
+	RegisterPlugin(name, noopFactory)
+	defer func() {
+		pluginsMutex.Lock()
+		delete(plugins, name)
+		pluginsMutex.Unlock()
+	}()
+
+	probed := ProbeVolumePlugins()
+	if _, ok := probed[name]; !ok {
+		t.Fatalf("ProbeVolumePlugins(): expected %q to be present", name)
+	}
+
+	// Mutating the returned map must not affect the registry.
+	delete(probed, name)
+	if _, ok := ProbeVolumePlugins()[name]; !ok {
+		t.Fatalf("ProbeVolumePlugins(): registry was mutated via the returned map")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/oracle/oci-volume-provisioner/pkg/oci/client"
+)
+
+const (
+	// defaultResyncPeriod bounds how long a VolumeSnapshotContent can go
+	// unnoticed if List is backed by a plain poll rather than a watch.
+	defaultResyncPeriod = 5 * time.Minute
+	maxRetries          = 10
+)
+
+// SnapshotContentClient is the subset of a VolumeSnapshotContent clientset
+// Controller needs: list every content object, and persist the
+// BackupID/ReadyToUse fields CreateSnapshot sets and the BackupID that
+// Controller clears after DeleteSnapshot. It is
+// defined here, rather than imported, because no VolumeSnapshotContent
+// clientset is vendored in this tree yet; a generated one can satisfy this
+// interface unchanged once it exists.
+type SnapshotContentClient interface {
+	List() ([]*VolumeSnapshotContent, error)
+	Update(content *VolumeSnapshotContent) error
+}
+
+// Controller reconciles VolumeSnapshotContent objects against OCI volume
+// backups: a resync-driven work queue with exponential retry/backoff,
+// analogous to the external-storage ProvisionController that drives
+// pkg/provisioner/block off PersistentVolumeClaims.
+type Controller struct {
+	client        client.ProvisionerClient
+	contentClient SnapshotContentClient
+	resyncPeriod  time.Duration
+	queue         workqueue.RateLimitingInterface
+}
+
+// NewController creates a Controller. Call Run to start it.
+func NewController(ociClient client.ProvisionerClient, contentClient SnapshotContentClient) *Controller {
+	return &Controller{
+		client:        ociClient,
+		contentClient: contentClient,
+		resyncPeriod:  defaultResyncPeriod,
+		queue:         workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+}
+
+// Run lists contentClient every resyncPeriod, enqueuing every content
+// object's name, and processes the queue with workers goroutines until
+// stopCh is closed.
+func (c *Controller) Run(workers int, stopCh <-chan struct{}) {
+	defer c.queue.ShutDown()
+
+	glog.Info("Starting VolumeSnapshotContent controller")
+	go wait.Until(c.enqueueAll, c.resyncPeriod, stopCh)
+
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	<-stopCh
+	glog.Info("Stopping VolumeSnapshotContent controller")
+}
+
+func (c *Controller) enqueueAll() {
+	contents, err := c.contentClient.List()
+	if err != nil {
+		glog.Errorf("failed to list VolumeSnapshotContent objects: %v", err)
+		return
+	}
+	for _, content := range contents {
+		c.queue.Add(content.Name)
+	}
+}
+
+func (c *Controller) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+func (c *Controller) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.reconcile(key.(string))
+	c.handleErr(err, key)
+	return true
+}
+
+func (c *Controller) handleErr(err error, key interface{}) {
+	if err == nil {
+		c.queue.Forget(key)
+		return
+	}
+
+	if c.queue.NumRequeues(key) < maxRetries {
+		glog.Warningf("error syncing VolumeSnapshotContent %v, retrying: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return
+	}
+
+	glog.Errorf("giving up syncing VolumeSnapshotContent %v after %d retries: %v", key, maxRetries, err)
+	c.queue.Forget(key)
+}
+
+// reconcile creates or deletes the OCI backup backing the content object
+// named key, depending on whether it has been marked Deleted.
+func (c *Controller) reconcile(key string) error {
+	contents, err := c.contentClient.List()
+	if err != nil {
+		return err
+	}
+
+	var content *VolumeSnapshotContent
+	for _, candidate := range contents {
+		if candidate.Name == key {
+			content = candidate
+			break
+		}
+	}
+	if content == nil {
+		// Already gone; nothing left to reconcile.
+		return nil
+	}
+
+	if content.Deleted {
+		return c.reconcileDelete(content)
+	}
+	return c.reconcileCreate(content)
+}
+
+func (c *Controller) reconcileCreate(content *VolumeSnapshotContent) error {
+	if content.BackupID != "" {
+		return nil
+	}
+
+	params, err := ResolveSnapshotClassParameters(content.Parameters)
+	if err != nil {
+		return err
+	}
+
+	if err := CreateSnapshot(c.client, content, params); err != nil {
+		return err
+	}
+
+	return c.contentClient.Update(content)
+}
+
+func (c *Controller) reconcileDelete(content *VolumeSnapshotContent) error {
+	if content.BackupID == "" {
+		return nil
+	}
+
+	if err := DeleteSnapshot(c.client, content); err != nil {
+		return err
+	}
+
+	content.BackupID = ""
+	return c.contentClient.Update(content)
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package snapshot drives OCI block volume backups on behalf of
+// snapshot.storage.k8s.io VolumeSnapshot/VolumeSnapshotContent objects, the
+// same way pkg/provisioner/block drives OCI block volumes on behalf of
+// PersistentVolumeClaims.
+//
+// Controller (see controller.go) is the reconcile loop that calls
+// CreateSnapshot/DeleteSnapshot below, analogous to the external-storage
+// ProvisionController driving pkg/provisioner/block. It is built against a
+// SnapshotContentClient interface rather than a real VolumeSnapshotContent
+// clientset, since no generated CRD clientset is vendored in this tree yet;
+// a caller wires Controller to the real CRD API once one is.
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/common"
+	"github.com/oracle/oci-go-sdk/core"
+	"github.com/oracle/oci-volume-provisioner/pkg/oci/client"
+)
+
+const (
+	// ociVolumeBackupID mirrors the annotation the block provisioner reads
+	// to restore a PV from an OCI volume backup. A ready VolumeSnapshotContent
+	// is translated into this annotation so that blockProvisioner.Provision
+	// can restore from it without needing to know about the snapshot API.
+	ociVolumeBackupID = "volume.beta.kubernetes.io/oci-volume-source"
+
+	backupTypeParam       = "backupType"
+	compartmentIDParam    = "compartmentId"
+	definedTagsParam      = "definedTags"
+	backupTypeFull        = "FULL"
+	backupTypeIncremental = "INCREMENTAL"
+)
+
+// SnapshotClassParameters are the parameters read off a SnapshotClass,
+// analogous to the StorageClass parameters resolveFSType/resolveVolumeParameters
+// read for provisioning.
+type SnapshotClassParameters struct {
+	BackupType    core.CreateVolumeBackupDetailsTypeEnum
+	CompartmentID string
+	DefinedTags   map[string]map[string]interface{}
+}
+
+// ResolveSnapshotClassParameters validates the parameter map off a
+// SnapshotClass the same way resolveFSType/resolveVolumeParameters validate
+// StorageClass parameters for provisioning.
+func ResolveSnapshotClassParameters(params map[string]string) (SnapshotClassParameters, error) {
+	result := SnapshotClassParameters{BackupType: core.CreateVolumeBackupDetailsTypeFull}
+
+	if backupType, ok := params[backupTypeParam]; ok {
+		switch backupType {
+		case backupTypeFull:
+			result.BackupType = core.CreateVolumeBackupDetailsTypeFull
+		case backupTypeIncremental:
+			result.BackupType = core.CreateVolumeBackupDetailsTypeIncremental
+		default:
+			return result, fmt.Errorf("invalid %s %q: must be %q or %q", backupTypeParam, backupType, backupTypeFull, backupTypeIncremental)
+		}
+	}
+
+	result.CompartmentID = params[compartmentIDParam]
+
+	if definedTagsStr, ok := params[definedTagsParam]; ok {
+		definedTags, err := parseDefinedTags(definedTagsStr)
+		if err != nil {
+			return result, err
+		}
+		result.DefinedTags = definedTags
+	}
+
+	return result, nil
+}
+
+// parseDefinedTags parses a definedTags SnapshotClass parameter of the form
+// "<namespace>.<tagkey>=<value>,...", the defined-tags half of the format
+// parseTags in pkg/provisioner/block accepts for the analogous StorageClass
+// annotation.
+func parseDefinedTags(tagStr string) (map[string]map[string]interface{}, error) {
+	defined := map[string]map[string]interface{}{}
+	if tagStr == "" {
+		return defined, nil
+	}
+
+	for _, tag := range strings.Split(tagStr, ",") {
+		parts := strings.Split(tag, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("tag format must follow <namespace>.<tagkey>=<value>: %q", tag)
+		}
+
+		keyParts := strings.Split(parts[0], ".")
+		if len(keyParts) != 2 {
+			return nil, fmt.Errorf("tag format must follow <namespace>.<tagkey>=<value>: %q", tag)
+		}
+
+		namespace, key := keyParts[0], keyParts[1]
+		if _, ok := defined[namespace]; !ok {
+			defined[namespace] = map[string]interface{}{}
+		}
+		defined[namespace][key] = parts[1]
+	}
+
+	return defined, nil
+}
+
+// VolumeSnapshotContent is the subset of the snapshot.storage.k8s.io
+// VolumeSnapshotContent object CreateSnapshot/DeleteSnapshot need. It
+// intentionally mirrors the upstream CRD shape rather than depending on a
+// vendored copy of it, the same way this package avoids depending on a
+// specific snapshot-controller version.
+type VolumeSnapshotContent struct {
+	Name              string
+	SourceVolumeID    string
+	SnapshotClassName string
+	Parameters        map[string]string
+
+	// BackupID is set once the OCI backup has been created.
+	BackupID string
+	// ReadyToUse mirrors status.readyToUse on the real CRD object.
+	ReadyToUse bool
+	// Deleted mirrors the real CRD object having a non-nil
+	// DeletionTimestamp: the Controller deletes the OCI backup and clears
+	// BackupID once it observes this, rather than on garbage collection.
+	Deleted bool
+}
+
+// CreateSnapshot creates an OCI volume backup for content and populates its
+// BackupID/ReadyToUse fields from the resulting OCI backup. Called by
+// Controller when a content object has no BackupID yet.
+func CreateSnapshot(client client.ProvisionerClient, content *VolumeSnapshotContent, params SnapshotClassParameters) error {
+	backupDetails := core.CreateVolumeBackupDetails{
+		VolumeId:    common.String(content.SourceVolumeID),
+		Type:        params.BackupType,
+		DisplayName: common.String(content.Name),
+		DefinedTags: params.DefinedTags,
+	}
+
+	if params.CompartmentID != "" {
+		backupDetails.CompartmentId = common.String(params.CompartmentID)
+	}
+
+	ctx, cancel := context.WithTimeout(client.Context(), client.Timeout())
+	defer cancel()
+
+	backup, err := client.BlockStorage().CreateVolumeBackup(ctx, core.CreateVolumeBackupRequest{
+		CreateVolumeBackupDetails: backupDetails,
+	})
+	if err != nil {
+		return err
+	}
+
+	content.BackupID = *backup.Id
+	content.ReadyToUse = backup.LifecycleState == core.VolumeBackupLifecycleStateAvailable
+
+	return nil
+}
+
+// DeleteSnapshot deletes the OCI volume backup backing content, skipping
+// 404s the same way blockProvisioner.Delete skips volumes that are already
+// gone. Called by Controller when a content object is marked Deleted.
+func DeleteSnapshot(client client.ProvisionerClient, content *VolumeSnapshotContent) error {
+	if content.BackupID == "" {
+		return errors.New("backup id not set on VolumeSnapshotContent")
+	}
+
+	ctx, cancel := context.WithTimeout(client.Context(), client.Timeout())
+	defer cancel()
+
+	response, err := client.BlockStorage().DeleteVolumeBackup(ctx, core.DeleteVolumeBackupRequest{
+		VolumeBackupId: common.String(content.BackupID),
+	})
+	if response.RawResponse != nil && response.RawResponse.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// VolumeBackupAnnotation returns the ociVolumeBackupID annotation value
+// that should be set on a restoring PVC so that blockProvisioner.Provision
+// restores from this snapshot via VolumeSourceFromVolumeBackupDetails.
+func VolumeBackupAnnotation(content *VolumeSnapshotContent) (string, string) {
+	return ociVolumeBackupID, content.BackupID
+}
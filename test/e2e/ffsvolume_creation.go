@@ -14,6 +14,15 @@
 
 package e2e
 
+// This suite stays commented out: it depends on test/e2e/framework, which
+// isn't vendored in this tree, and exercises the "oracle.com/oci-fss"
+// provisioner, whose pkg/provisioner/fss backend is still a stub that
+// unconditionally returns "not yet implemented" for Provision/Delete.
+// pkg/provisioner/plugin's registry (this chunk) makes FSS discoverable by
+// StorageClass name alongside block, but does not by itself make either of
+// those two gaps go away, so uncommenting this would neither compile nor
+// pass.
+
 /*
 import (
 	. "github.com/onsi/ginkgo"